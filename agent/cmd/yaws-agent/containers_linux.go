@@ -0,0 +1,372 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// containerSampler tracks per-container CPU usage deltas (cgroup cpu.stat's
+// cumulative usage_usec) across calls to Read, analogous to procSampler but
+// keyed by container id and driven by wall-clock time rather than jiffies,
+// since cgroup accounting already reports microseconds directly.
+type containerSampler struct {
+	prevUsec map[string]uint64
+	prevAt   time.Time
+	ready    bool
+}
+
+func newContainerSampler() *containerSampler {
+	return &containerSampler{prevUsec: make(map[string]uint64)}
+}
+
+// Read enumerates containers under the hierarchy selected by mode ("docker"
+// or "k8s") and reports CPU, memory, and network usage for each. mode == ""
+// or "off" returns nil without error.
+func (cs *containerSampler) Read(mode string) ([]containerMetric, error) {
+	if mode == "" || mode == "off" {
+		return nil, nil
+	}
+
+	scopes, err := findContainerScopes(mode)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	elapsedUsec := uint64(now.Sub(cs.prevAt).Microseconds())
+
+	metrics := make([]containerMetric, 0, len(scopes))
+	nextUsec := make(map[string]uint64, len(scopes))
+	for _, sc := range scopes {
+		usageUsec, ok := readCgroupCPUUsecAny(sc.paths)
+		if !ok {
+			continue
+		}
+		nextUsec[sc.id] = usageUsec
+
+		var cpuPct float64
+		if cs.ready && elapsedUsec > 0 {
+			if prev, ok := cs.prevUsec[sc.id]; ok && usageUsec >= prev {
+				cpuPct = float64(usageUsec-prev) / float64(elapsedUsec) * 100
+			}
+		}
+
+		memUsed, memLimit := readCgroupMemAny(sc.paths)
+
+		var rx, tx int64
+		if pid, ok := firstCgroupPIDAny(sc.paths); ok {
+			rx, tx = readContainerNet(pid)
+		}
+
+		metrics = append(metrics, containerMetric{
+			ID:         sc.id,
+			Name:       resolveContainerName(sc.id, sc.leaf),
+			CPUPercent: cpuPct,
+			MemUsed:    memUsed,
+			MemLimit:   memLimit,
+			RxBytes:    rx,
+			TxBytes:    tx,
+		})
+	}
+
+	cs.prevUsec = nextUsec
+	cs.prevAt = now
+	cs.ready = true
+
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].ID < metrics[j].ID })
+	return metrics, nil
+}
+
+// containerScope identifies the cgroup leaf directory (or directories) that
+// correspond to a single container. On cgroup v2 there is exactly one path:
+// the unified hierarchy holds cpu, memory, and pids accounting together. On
+// cgroup v1 the controllers are separate hierarchies mounted at different
+// paths (e.g. ".../cpu,cpuacct/.../docker-<id>.scope" and
+// ".../memory/.../docker-<id>.scope"), so paths holds one entry per
+// controller subtree that matched this container id.
+type containerScope struct {
+	id    string
+	leaf  string
+	paths []string
+}
+
+// findContainerScopes walks the cgroup hierarchy (v1 or v2, wherever it is
+// mounted) for leaf directories that belong to a single container, grouping
+// every matching path by container id so v1's per-controller hierarchies
+// (cpu, memory, ...) for the same container are read together rather than
+// only whichever controller's subtree happens to be walked first. "docker"
+// matches systemd-scoped docker units anywhere under /sys/fs/cgroup (covering
+// both the top-level layout and the legacy system.slice placement) plus the
+// cgroupfs driver's bare "docker/<id>" layout; "k8s" restricts the search to
+// the kubepods hierarchy, where both cgroup drivers nest one container cgroup
+// per pod.
+func findContainerScopes(mode string) ([]containerScope, error) {
+	root := "/sys/fs/cgroup"
+	byID := make(map[string]*containerScope)
+	var order []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // skip unreadable subtrees, e.g. permission-denied leaves
+		}
+		if path == root || !d.IsDir() {
+			return nil
+		}
+		id, ok := containerIDFromLeaf(d.Name())
+		if !ok {
+			return nil
+		}
+		isKubepods := strings.Contains(path, "kubepods")
+		if mode == "k8s" && !isKubepods {
+			return nil
+		}
+		if mode == "docker" && isKubepods {
+			return nil
+		}
+		sc, ok := byID[id]
+		if !ok {
+			sc = &containerScope{id: id, leaf: d.Name()}
+			byID[id] = sc
+			order = append(order, id)
+		}
+		sc.paths = append(sc.paths, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	scopes := make([]containerScope, 0, len(order))
+	for _, id := range order {
+		scopes = append(scopes, *byID[id])
+	}
+	return scopes, nil
+}
+
+// containerIDFromLeaf extracts a container id from a cgroup leaf directory
+// name, recognizing both the systemd cgroup driver's "<runtime>-<id>.scope"
+// units and the legacy cgroupfs driver's bare hex-id directories.
+func containerIDFromLeaf(name string) (string, bool) {
+	if strings.HasSuffix(name, ".scope") {
+		base := strings.TrimSuffix(name, ".scope")
+		idx := strings.LastIndexByte(base, '-')
+		if idx < 0 {
+			return "", false
+		}
+		id := base[idx+1:]
+		if isHexID(id) {
+			return id, true
+		}
+		return "", false
+	}
+	if isHexID(name) {
+		return name, true
+	}
+	return "", false
+}
+
+func isHexID(s string) bool {
+	if len(s) < 12 {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// readCgroupCPUUsecAny tries readCgroupCPUUsec against each of a container's
+// controller-hierarchy paths, returning the first one that has CPU
+// accounting. On cgroup v1 only the cpu/cpuacct subtree has it; the others
+// fail and are skipped.
+func readCgroupCPUUsecAny(paths []string) (uint64, bool) {
+	for _, p := range paths {
+		if usec, err := readCgroupCPUUsec(p); err == nil {
+			return usec, true
+		}
+	}
+	return 0, false
+}
+
+// readCgroupCPUUsec returns cumulative CPU usage in microseconds for the
+// cgroup at path, handling both v2 (cpu.stat's usage_usec line) and v1
+// (cpuacct.usage, reported in nanoseconds).
+func readCgroupCPUUsec(path string) (uint64, error) {
+	if f, err := os.Open(filepath.Join(path, "cpu.stat")); err == nil {
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			fields := strings.Fields(sc.Text())
+			if len(fields) == 2 && fields[0] == "usage_usec" {
+				return strconv.ParseUint(fields[1], 10, 64)
+			}
+		}
+	}
+	if b, err := os.ReadFile(filepath.Join(path, "cpuacct.usage")); err == nil {
+		ns, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return ns / 1000, nil
+	}
+	return 0, fmt.Errorf("no cgroup cpu usage file under %s", path)
+}
+
+// readCgroupMemAny tries readCgroupMem against each of a container's
+// controller-hierarchy paths, returning the first one that has memory
+// accounting. On cgroup v1 the memory controller is a separate hierarchy
+// from cpu/cpuacct, so the scope that satisfied readCgroupCPUUsecAny is
+// often not the one that has memory.usage_in_bytes.
+func readCgroupMemAny(paths []string) (used, limit int64) {
+	for _, p := range paths {
+		if u, l, ok := readCgroupMem(p); ok {
+			return u, l
+		}
+	}
+	return 0, 0
+}
+
+// readCgroupMem reports current and limit memory usage in bytes, handling
+// both v2 (memory.current/memory.max, where "max" means unlimited) and v1
+// (memory.usage_in_bytes/memory.limit_in_bytes, where an unlimited cgroup
+// reports a platform-specific sentinel near the max int64). ok is false when
+// path's hierarchy has no memory accounting files at all, distinguishing
+// "no memory controller here" from "zero bytes used".
+func readCgroupMem(path string) (used int64, limit int64, ok bool) {
+	if b, err := os.ReadFile(filepath.Join(path, "memory.current")); err == nil {
+		used, _ = strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+		if lb, err := os.ReadFile(filepath.Join(path, "memory.max")); err == nil {
+			if s := strings.TrimSpace(string(lb)); s != "max" {
+				limit, _ = strconv.ParseInt(s, 10, 64)
+			}
+		}
+		return used, limit, true
+	}
+	if b, err := os.ReadFile(filepath.Join(path, "memory.usage_in_bytes")); err == nil {
+		used, _ = strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+		if lb, err := os.ReadFile(filepath.Join(path, "memory.limit_in_bytes")); err == nil {
+			if l, err := strconv.ParseInt(strings.TrimSpace(string(lb)), 10, 64); err == nil && l < 1<<62 {
+				limit = l
+			}
+		}
+		return used, limit, true
+	}
+	return 0, 0, false
+}
+
+// firstCgroupPIDAny tries firstCgroupPID against each of a container's
+// controller-hierarchy paths, since cgroup.procs is populated per-hierarchy
+// on cgroup v1 and not every controller's subtree is guaranteed to list it.
+func firstCgroupPIDAny(paths []string) (int, bool) {
+	for _, p := range paths {
+		if pid, ok := firstCgroupPID(p); ok {
+			return pid, true
+		}
+	}
+	return 0, false
+}
+
+// firstCgroupPID returns a representative pid for the cgroup at path, read
+// from cgroup.procs, so its network namespace can be inspected.
+func firstCgroupPID(path string) (int, bool) {
+	b, err := os.ReadFile(filepath.Join(path, "cgroup.procs"))
+	if err != nil {
+		return 0, false
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, false
+	}
+	return pid, true
+}
+
+// readContainerNet reports rx/tx bytes summed across a container's
+// non-loopback interfaces by entering its network namespace and re-reading
+// /proc/net/dev, then restoring the agent's own namespace. This requires
+// CAP_SYS_ADMIN; a failure here just means network stats are left at 0, not
+// a fatal error for the rest of the sample.
+//
+// The namespace switch runs in a dedicated, disposable goroutine rather than
+// the caller's: setns affects only the calling thread, so the goroutine pins
+// itself to its OS thread for the duration of the switch. If restoring the
+// agent's own namespace afterwards fails, that thread is stuck inside the
+// container's netns and must never go back to the runtime's thread pool —
+// an unrelated goroutine scheduled onto it would silently make network
+// syscalls in the wrong namespace. runtime.Goexit retires the goroutine
+// (and its thread) instead of unlocking it in that case.
+func readContainerNet(pid int) (rxBytes, txBytes int64) {
+	targetNS, err := os.Open(fmt.Sprintf("/proc/%d/ns/net", pid))
+	if err != nil {
+		return 0, 0
+	}
+	defer targetNS.Close()
+
+	selfNS, err := os.Open("/proc/self/ns/net")
+	if err != nil {
+		return 0, 0
+	}
+	defer selfNS.Close()
+
+	type result struct{ rx, tx int64 }
+	resCh := make(chan result, 1)
+	go func() {
+		runtime.LockOSThread()
+
+		if err := unix.Setns(int(targetNS.Fd()), unix.CLONE_NEWNET); err != nil {
+			runtime.UnlockOSThread()
+			resCh <- result{}
+			return
+		}
+
+		rx, tx, readErr := readNet()
+
+		if err := unix.Setns(int(selfNS.Fd()), unix.CLONE_NEWNET); err != nil {
+			resCh <- result{}
+			runtime.Goexit()
+		}
+		runtime.UnlockOSThread()
+
+		if readErr != nil {
+			resCh <- result{}
+			return
+		}
+		resCh <- result{rx, tx}
+	}()
+
+	res := <-resCh
+	return res.rx, res.tx
+}
+
+// resolveContainerName resolves a human-friendly container name by reading
+// dockerd's own state file when it's readable (typically requires root),
+// falling back to the cgroup leaf name otherwise.
+func resolveContainerName(id, leaf string) string {
+	b, err := os.ReadFile(filepath.Join("/var/lib/docker/containers", id, "config.v2.json"))
+	if err != nil {
+		return leaf
+	}
+	var cfg struct {
+		Name string `json:"Name"`
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil || cfg.Name == "" {
+		return leaf
+	}
+	return strings.TrimPrefix(cfg.Name, "/")
+}
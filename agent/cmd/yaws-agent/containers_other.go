@@ -0,0 +1,16 @@
+//go:build !linux
+
+package main
+
+// noopContainerSampler satisfies the readContainers shape of metricsSource on
+// platforms without a cgroup filesystem. --containers is still accepted as a
+// flag there, it just never finds anything to report.
+type noopContainerSampler struct{}
+
+func newContainerSampler() *noopContainerSampler {
+	return &noopContainerSampler{}
+}
+
+func (*noopContainerSampler) Read(mode string) ([]containerMetric, error) {
+	return nil, nil
+}
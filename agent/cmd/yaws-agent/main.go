@@ -12,9 +12,13 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
+
+	"github.com/yamatu/yaws/agent/spool"
 )
 
 type helloMsg struct {
@@ -28,6 +32,10 @@ type helloMsg struct {
 	Kernel    string `json:"kernelVersion,omitempty"`
 	CPUModel  string `json:"cpuModel,omitempty"`
 	CPUCores  int    `json:"cpuCores,omitempty"`
+	// BootTime lets the controller tell a reboot apart from a network blip:
+	// compare it against the previously stored value for this machine.
+	BootTime int64 `json:"bootTime,omitempty"`
+	Uptime   int64 `json:"uptimeSec,omitempty"`
 }
 
 type metricsMsg struct {
@@ -37,13 +45,20 @@ type metricsMsg struct {
 		Usage float64 `json:"usage"`
 	} `json:"cpu"`
 	Mem struct {
-		Used  int64 `json:"used"`
-		Total int64 `json:"total"`
+		Used      int64 `json:"used"`
+		Total     int64 `json:"total"`
+		SwapUsed  int64 `json:"swapUsed,omitempty"`
+		SwapTotal int64 `json:"swapTotal,omitempty"`
 	} `json:"mem"`
+	// Disk is the aggregate usage of the single --disk path. Deprecated: use
+	// Disks for a per-mount-point breakdown; kept for backward compatibility.
 	Disk struct {
 		Used  int64 `json:"used"`
 		Total int64 `json:"total"`
 	} `json:"disk"`
+	// Net is the summed rx/tx across all non-loopback interfaces.
+	// Deprecated: use Nets for a per-interface breakdown; kept for backward
+	// compatibility.
 	Net struct {
 		RxBytes int64 `json:"rxBytes"`
 		TxBytes int64 `json:"txBytes"`
@@ -57,12 +72,111 @@ type metricsMsg struct {
 		L5  float64 `json:"l5"`
 		L15 float64 `json:"l15"`
 	} `json:"load,omitempty"`
+	Procs []procMetric `json:"procs,omitempty"`
+	Nets  []netMetric  `json:"nets,omitempty"`
+	Disks []diskMetric `json:"disks,omitempty"`
+	// Uptime is in seconds; BootTime is a Unix timestamp so the controller
+	// can detect reboots between reconnects the same way hello does.
+	Uptime   int64 `json:"uptimeSec,omitempty"`
+	BootTime int64 `json:"bootTime,omitempty"`
+	Users    int   `json:"users,omitempty"`
+	// Containers is populated when --containers is docker or k8s; empty
+	// (omitted) when off, or when no containers were found.
+	Containers []containerMetric `json:"containers,omitempty"`
+}
+
+// netMetric is a per-interface breakdown of /proc/net/dev's bytes, packets,
+// errs, and drop counters for each direction.
+type netMetric struct {
+	Name      string `json:"name"`
+	RxBytes   int64  `json:"rxBytes"`
+	TxBytes   int64  `json:"txBytes"`
+	RxPackets int64  `json:"rxPackets"`
+	TxPackets int64  `json:"txPackets"`
+	RxErrs    int64  `json:"rxErrs"`
+	TxErrs    int64  `json:"txErrs"`
+	RxDrop    int64  `json:"rxDrop"`
+	TxDrop    int64  `json:"txDrop"`
+}
+
+// diskMetric is a per-mount-point breakdown of space, inode, and (when
+// available) block device IO usage.
+type diskMetric struct {
+	Mount      string `json:"mount"`
+	Device     string `json:"device,omitempty"`
+	Used       int64  `json:"used"`
+	Total      int64  `json:"total"`
+	InodeUsed  int64  `json:"inodeUsed"`
+	InodeTotal int64  `json:"inodeTotal"`
+	Reads      int64  `json:"reads,omitempty"`
+	Writes     int64  `json:"writes,omitempty"`
+	ReadBytes  int64  `json:"readBytes,omitempty"`
+	WriteBytes int64  `json:"writeBytes,omitempty"`
+	IOTimeMs   int64  `json:"ioTimeMs,omitempty"`
+}
+
+// procMetric describes a single process in the metrics payload's top-N list.
+type procMetric struct {
+	Pid        int     `json:"pid"`
+	Name       string  `json:"name"`
+	User       string  `json:"user,omitempty"`
+	CPUPercent float64 `json:"cpuPercent"`
+	RSSBytes   int64   `json:"rssBytes"`
+	FDCount    int     `json:"fds"`
+}
+
+// containerMetric describes one container discovered under the cgroup
+// hierarchy selected by --containers.
+type containerMetric struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	CPUPercent float64 `json:"cpuPercent"`
+	MemUsed    int64   `json:"memUsed"`
+	MemLimit   int64   `json:"memLimit,omitempty"`
+	RxBytes    int64   `json:"rxBytes,omitempty"`
+	TxBytes    int64   `json:"txBytes,omitempty"`
 }
 
 type helloOkMsg struct {
 	Type        string `json:"type"`
 	MachineID   int    `json:"machineId"`
 	IntervalSec int    `json:"intervalSec"`
+	TopProcs    int    `json:"topProcs,omitempty"`
+}
+
+// metricsBatchMsg replays spooled samples from earlier connections. Each
+// item keeps its original `at` timestamp so the controller can backfill the
+// history gap instead of treating every item as "now".
+type metricsBatchMsg struct {
+	Type  string       `json:"type"`
+	Items []metricsMsg `json:"items"`
+}
+
+// cpuUsager is satisfied by both the native /proc-based cpuSampler and the
+// gopsutil-backed sampler, so collectMetrics does not need to care which
+// backend produced it.
+type cpuUsager interface {
+	Usage() (float64, error)
+}
+
+// metricsSource bundles the sampling functions collectMetrics needs. It lets
+// --backend=gopsutil swap in the collector package's implementation without
+// changing collectMetrics itself.
+type metricsSource struct {
+	cpu            cpuUsager
+	readMem        func() (int64, int64, error)
+	readDisk       func(string) (int64, int64, error)
+	readNet        func() (int64, int64, error)
+	readLoad       func() (float64, float64, float64, error)
+	readConnCounts func() (int64, int64, error)
+	topProcs       func(n int) ([]procMetric, error)
+	readNets       func() ([]netMetric, error)
+	readDisks      func() ([]diskMetric, error)
+	readUptime     func() (float64, error)
+	readBootTime   func() (int64, error)
+	readSwap       func() (int64, int64, error)
+	readUsers      func() (int, error)
+	readContainers func(mode string) ([]containerMetric, error)
 }
 
 var (
@@ -78,6 +192,12 @@ func main() {
 	var interval time.Duration
 	var diskPath string
 	var showVersion bool
+	var backend string
+	var topProcs int
+	var spoolDir string
+	var spoolMaxBytesStr string
+	var promListen string
+	var containersMode string
 
 	flag.StringVar(&configPath, "config", "", "path to agent config json (download from controller)")
 	flag.StringVar(&wsURL, "url", "", "ws url, e.g. ws://host:3001/ws/agent")
@@ -86,6 +206,12 @@ func main() {
 	flag.DurationVar(&interval, "interval", 5*time.Second, "metrics interval (server may override)")
 	flag.StringVar(&diskPath, "disk", "/", "disk path to measure, default /")
 	flag.BoolVar(&showVersion, "version", false, "print version and exit")
+	flag.StringVar(&backend, "backend", "", "metrics backend: \"\" (native, default) or \"gopsutil\" (cross-platform, for parity testing on Linux)")
+	flag.IntVar(&topProcs, "top-procs", 0, "include the top N processes by CPU/RSS in each metrics payload (0 disables, server may override)")
+	flag.StringVar(&spoolDir, "spool", "", "directory for an on-disk store-and-forward buffer; empty disables spooling")
+	flag.StringVar(&spoolMaxBytesStr, "spool-max-bytes", "32MiB", "total spool size cap, e.g. 512KiB, 32MiB, 1GiB")
+	flag.StringVar(&promListen, "prom-listen", "", "address to serve OpenMetrics /metrics on, e.g. :9100; empty disables it")
+	flag.StringVar(&containersMode, "containers", "off", "container metrics source: \"docker\", \"k8s\", or \"off\" (default)")
 	flag.Parse()
 
 	if showVersion {
@@ -121,8 +247,13 @@ func main() {
 		os.Exit(2)
 	}
 
-	if runtime.GOOS != "linux" {
-		log.Printf("warning: GOOS=%s is not fully supported; metrics may fail", runtime.GOOS)
+	if runtime.GOOS != "linux" && backend == "gopsutil" {
+		log.Printf("note: --backend=gopsutil is implied on GOOS=%s", runtime.GOOS)
+	}
+
+	if containersMode != "off" && containersMode != "docker" && containersMode != "k8s" {
+		log.Printf("unknown -containers %q; disabling container metrics", containersMode)
+		containersMode = "off"
 	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
@@ -131,10 +262,37 @@ func main() {
 	hostname, _ := os.Hostname()
 	sys := getSysInfo()
 
-	cpu := newCPUSampler()
+	var sp *spool.Spool
+	if spoolDir != "" {
+		spoolMaxBytes, err := parseByteSize(spoolMaxBytesStr)
+		if err != nil {
+			log.Printf("bad -spool-max-bytes %q: %v; spooling disabled", spoolMaxBytesStr, err)
+		} else if sp, err = spool.New(spoolDir, spoolMaxBytes); err != nil {
+			log.Printf("spool init failed: %v; spooling disabled", err)
+			sp = nil
+		}
+	}
+
+	promSrc := selectMetricsSource(backend)
+	shared := &sharedSource{
+		src:                selectMetricsSource(backend),
+		promTopProcs:       promSrc.topProcs,
+		promReadContainers: promSrc.readContainers,
+	}
+
+	if promListen != "" {
+		promSrv := startPromServer(promListen, shared, diskPath, topProcs, containersMode)
+		go func() {
+			if err := promSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("prom listener failed: %v", err)
+			}
+		}()
+		defer shutdownPromServer(promSrv)
+	}
+
 	backoff := 800 * time.Millisecond
 	for ctx.Err() == nil {
-		err := runOnce(ctx, wsURL, machineID, key, hostname, sys, interval, diskPath, cpu)
+		err := runOnce(ctx, wsURL, machineID, key, hostname, sys, interval, diskPath, shared, topProcs, sp, containersMode)
 		if err == nil || ctx.Err() != nil {
 			break
 		}
@@ -157,7 +315,10 @@ func runOnce(
 	sys sysInfo,
 	interval time.Duration,
 	diskPath string,
-	cpu *cpuSampler,
+	shared *sharedSource,
+	topProcs int,
+	sp *spool.Spool,
+	containers string,
 ) error {
 	dialer := websocket.Dialer{
 		Proxy: http.ProxyFromEnvironment,
@@ -186,6 +347,16 @@ func runOnce(
 		CPUModel:  sys.CPUModel,
 		CPUCores:  sys.CPUCores,
 	}
+	if shared.src.readBootTime != nil {
+		if bootTime, err := shared.src.readBootTime(); err == nil {
+			hello.BootTime = bootTime
+		}
+	}
+	if shared.src.readUptime != nil {
+		if uptime, err := shared.src.readUptime(); err == nil {
+			hello.Uptime = int64(uptime)
+		}
+	}
 	if err := conn.WriteJSON(hello); err != nil {
 		return err
 	}
@@ -197,12 +368,23 @@ func runOnce(
 		return err
 	}
 	var ok helloOkMsg
-	if err := json.Unmarshal(b, &ok); err == nil && ok.Type == "hello_ok" && ok.IntervalSec >= 2 {
-		serverInterval = time.Duration(ok.IntervalSec) * time.Second
+	if err := json.Unmarshal(b, &ok); err == nil && ok.Type == "hello_ok" {
+		if ok.IntervalSec >= 2 {
+			serverInterval = time.Duration(ok.IntervalSec) * time.Second
+		}
+		if ok.TopProcs > 0 {
+			topProcs = ok.TopProcs
+		}
+	}
+
+	if sp != nil {
+		if err := drainSpool(conn, sp); err != nil {
+			return err
+		}
 	}
 
 	// warm up CPU baseline to avoid always-0 first sample on Linux.
-	_, _ = cpu.Usage()
+	shared.warmupCPU()
 
 	pingTicker := time.NewTicker(25 * time.Second)
 	defer pingTicker.Stop()
@@ -235,45 +417,56 @@ func runOnce(
 		case <-pingTicker.C:
 			_ = conn.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(5*time.Second))
 		case <-ticker.C:
-			m, err := collectMetrics(diskPath, cpu)
+			m, err := shared.collect(diskPath, topProcs, containers)
 			if err != nil {
 				log.Printf("collect metrics failed: %v", err)
 				continue
 			}
 			m.Type = "metrics"
 			m.At = time.Now().UnixMilli()
-			if err := conn.WriteJSON(m); err != nil {
+
+			data, err := json.Marshal(m)
+			if err != nil {
+				log.Printf("marshal metrics failed: %v", err)
+				continue
+			}
+			if sp != nil {
+				if err := sp.Append(data); err != nil {
+					log.Printf("spool append failed: %v", err)
+				}
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
 				return err
 			}
 		}
 	}
 }
 
-func collectMetrics(diskPath string, cpu *cpuSampler) (metricsMsg, error) {
+func collectMetrics(diskPath string, src metricsSource, topProcs int, containers string) (metricsMsg, error) {
 	var m metricsMsg
-	cpuUsage, err := cpu.Usage()
+	cpuUsage, err := src.cpu.Usage()
 	if err != nil {
 		return m, err
 	}
-	memUsed, memTotal, err := readMem()
+	memUsed, memTotal, err := src.readMem()
 	if err != nil {
 		return m, err
 	}
-	diskUsed, diskTotal, err := readDisk(diskPath)
+	diskUsed, diskTotal, err := src.readDisk(diskPath)
 	if err != nil {
 		return m, err
 	}
-	rx, tx, err := readNet()
+	rx, tx, err := src.readNet()
 	if err != nil {
 		// optional
 		rx, tx = 0, 0
 	}
-	l1, l5, l15, err := readLoad()
+	l1, l5, l15, err := src.readLoad()
 	if err != nil {
 		l1, l5, l15 = 0, 0, 0
 	}
 
-	tcpConn, udpConn, err := readConnCounts()
+	tcpConn, udpConn, err := src.readConnCounts()
 	if err == nil {
 		m.Conn = &struct {
 			TCP int64 `json:"tcp"`
@@ -291,6 +484,48 @@ func collectMetrics(diskPath string, cpu *cpuSampler) (metricsMsg, error) {
 	m.Load.L1 = l1
 	m.Load.L5 = l5
 	m.Load.L15 = l15
+
+	if topProcs > 0 && src.topProcs != nil {
+		if procs, err := src.topProcs(topProcs); err == nil {
+			m.Procs = procs
+		}
+	}
+	if src.readNets != nil {
+		if nets, err := src.readNets(); err == nil {
+			m.Nets = nets
+		}
+	}
+	if src.readDisks != nil {
+		if disks, err := src.readDisks(); err == nil {
+			m.Disks = disks
+		}
+	}
+	if src.readSwap != nil {
+		if swapUsed, swapTotal, err := src.readSwap(); err == nil {
+			m.Mem.SwapUsed = swapUsed
+			m.Mem.SwapTotal = swapTotal
+		}
+	}
+	if src.readUptime != nil {
+		if uptime, err := src.readUptime(); err == nil {
+			m.Uptime = int64(uptime)
+		}
+	}
+	if src.readBootTime != nil {
+		if bootTime, err := src.readBootTime(); err == nil {
+			m.BootTime = bootTime
+		}
+	}
+	if src.readUsers != nil {
+		if users, err := src.readUsers(); err == nil {
+			m.Users = users
+		}
+	}
+	if containers != "" && containers != "off" && src.readContainers != nil {
+		if cs, err := src.readContainers(containers); err == nil {
+			m.Containers = cs
+		}
+	}
 	return m, nil
 }
 
@@ -336,3 +571,63 @@ func readConfig(path string) (agentConfig, error) {
 	}
 	return cfg, nil
 }
+
+// drainSpool replays every spooled sample as a single metrics_batch and, on
+// success, clears the spool. runOnce spools every sample before sending it
+// and only this function clears the spool, so replayed items include samples
+// already delivered live during earlier connections (up to the spool's byte
+// cap); the controller dedupes/backfills by each item's `at` timestamp.
+func drainSpool(conn *websocket.Conn, sp *spool.Spool) error {
+	frames, err := sp.Frames()
+	if err != nil {
+		log.Printf("spool read failed: %v", err)
+		return nil
+	}
+	if len(frames) == 0 {
+		return nil
+	}
+
+	batch := metricsBatchMsg{Type: "metrics_batch"}
+	for _, f := range frames {
+		var m metricsMsg
+		if err := json.Unmarshal(f, &m); err != nil {
+			continue
+		}
+		batch.Items = append(batch.Items, m)
+	}
+	if len(batch.Items) == 0 {
+		return nil
+	}
+
+	if err := conn.WriteJSON(batch); err != nil {
+		return err
+	}
+	if err := sp.Clear(); err != nil {
+		log.Printf("spool clear failed: %v", err)
+	}
+	return nil
+}
+
+// parseByteSize parses sizes like "512", "512KiB", "32MiB", "1GiB".
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	units := []struct {
+		suffix string
+		mult   int64
+	}{
+		{"GiB", 1 << 30},
+		{"MiB", 1 << 20},
+		{"KiB", 1 << 10},
+		{"B", 1},
+	}
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			n, err := strconv.ParseInt(strings.TrimSuffix(s, u.suffix), 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return n * u.mult, nil
+		}
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
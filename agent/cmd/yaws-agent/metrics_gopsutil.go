@@ -0,0 +1,80 @@
+package main
+
+import "github.com/yamatu/yaws/agent/collector"
+
+// newGopsutilTopProcs returns a topProcs sampler bound to its own
+// collector.ProcSampler instance, analogous to newProcSampler().Top on
+// Linux, so each caller (the websocket pipeline, the Prometheus scrape
+// handler) tracks CPU deltas across its own calls rather than sharing one
+// instance's delta window.
+func newGopsutilTopProcs() func(n int) ([]procMetric, error) {
+	ps := collector.NewProcSampler()
+	return func(n int) ([]procMetric, error) {
+		procs, err := ps.Top(n)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]procMetric, 0, len(procs))
+		for _, p := range procs {
+			out = append(out, procMetric{
+				Pid:        int(p.Pid),
+				Name:       p.Name,
+				User:       p.User,
+				CPUPercent: p.CPUPercent,
+				RSSBytes:   p.RSSBytes,
+				FDCount:    int(p.FDCount),
+			})
+		}
+		return out, nil
+	}
+}
+
+// gopsutilReadNets adapts collector.ReadNets to the metricsSource.readNets
+// shape shared by every GOOS.
+func gopsutilReadNets() ([]netMetric, error) {
+	nets, err := collector.ReadNets()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]netMetric, 0, len(nets))
+	for _, n := range nets {
+		out = append(out, netMetric{
+			Name:      n.Name,
+			RxBytes:   n.RxBytes,
+			TxBytes:   n.TxBytes,
+			RxPackets: n.RxPackets,
+			TxPackets: n.TxPackets,
+			RxErrs:    n.RxErrs,
+			TxErrs:    n.TxErrs,
+			RxDrop:    n.RxDrop,
+			TxDrop:    n.TxDrop,
+		})
+	}
+	return out, nil
+}
+
+// gopsutilReadDisks adapts collector.ReadDisks to the metricsSource.readDisks
+// shape shared by every GOOS.
+func gopsutilReadDisks() ([]diskMetric, error) {
+	disks, err := collector.ReadDisks()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]diskMetric, 0, len(disks))
+	for _, d := range disks {
+		out = append(out, diskMetric{
+			Mount:      d.Mount,
+			Device:     d.Device,
+			Used:       d.Used,
+			Total:      d.Total,
+			InodeUsed:  d.InodeUsed,
+			InodeTotal: d.InodeTotal,
+			Reads:      d.Reads,
+			Writes:     d.Writes,
+			ReadBytes:  d.ReadBytes,
+			WriteBytes: d.WriteBytes,
+			IOTimeMs:   d.IOTimeMs,
+		})
+	}
+	return out, nil
+}
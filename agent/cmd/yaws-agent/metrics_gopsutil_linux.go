@@ -0,0 +1,60 @@
+//go:build linux
+
+package main
+
+import "github.com/yamatu/yaws/agent/collector"
+
+// gopsutilCPUSampler lets --backend=gopsutil reuse the cpuUsager abstraction
+// on Linux for parity testing against the native /proc-based cpuSampler.
+type gopsutilCPUSampler struct {
+	s *collector.Sampler
+}
+
+func newGopsutilMetricsSource() metricsSource {
+	return metricsSource{
+		cpu:            &gopsutilCPUSampler{s: collector.NewSampler()},
+		readMem:        collector.ReadMem,
+		readDisk:       collector.ReadDisk,
+		readNet:        collector.ReadNet,
+		readLoad:       collector.ReadLoad,
+		readConnCounts: collector.ReadConnCounts,
+		topProcs:       newGopsutilTopProcs(),
+		readNets:       gopsutilReadNets,
+		readDisks:      gopsutilReadDisks,
+		readUptime:     collector.ReadUptime,
+		readBootTime:   collector.ReadBootTime,
+		readSwap:       collector.ReadSwap,
+		readUsers:      collector.CountUsers,
+		readContainers: newContainerSampler().Read,
+	}
+}
+
+func (c *gopsutilCPUSampler) Usage() (float64, error) {
+	return c.s.Usage()
+}
+
+func defaultMetricsSource() metricsSource {
+	return metricsSource{
+		cpu:            newCPUSampler(),
+		readMem:        readMem,
+		readDisk:       readDisk,
+		readNet:        readNet,
+		readLoad:       readLoad,
+		readConnCounts: readConnCounts,
+		topProcs:       newProcSampler().Top,
+		readNets:       readNets,
+		readDisks:      readDisks,
+		readUptime:     readUptime,
+		readBootTime:   readBootTime,
+		readSwap:       readSwap,
+		readUsers:      countUsers,
+		readContainers: newContainerSampler().Read,
+	}
+}
+
+func selectMetricsSource(backend string) metricsSource {
+	if backend == "gopsutil" {
+		return newGopsutilMetricsSource()
+	}
+	return defaultMetricsSource()
+}
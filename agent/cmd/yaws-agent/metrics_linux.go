@@ -6,6 +6,10 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
@@ -251,3 +255,510 @@ func countProcNetConns(filePath string) (int64, error) {
 	}
 	return n, nil
 }
+
+// procSampler tracks per-pid CPU time deltas across calls to Top, analogous
+// to cpuSampler but keyed by pid instead of a single aggregate.
+type procSampler struct {
+	prevTotal uint64
+	prevTicks map[int]uint64
+	ready     bool
+}
+
+func newProcSampler() *procSampler {
+	return &procSampler{prevTicks: make(map[int]uint64)}
+}
+
+// Top returns the n busiest processes by CPU percent (ties broken by RSS).
+// n <= 0 returns all processes. The expensive lookups are kept proportional
+// to n rather than to the total process count: every pid is scored on the
+// cheap /proc/[pid]/stat and /proc/[pid]/status reads alone, and only the top
+// n pay for cmdline, NSS username resolution, and an fd directory listing.
+func (p *procSampler) Top(n int) ([]procMetric, error) {
+	_, total, err := readProcStatCPU()
+	if err != nil {
+		return nil, err
+	}
+
+	pids, err := listPIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make([]procMetric, 0, len(pids))
+	nextTicks := make(map[int]uint64, len(pids))
+	for _, pid := range pids {
+		ticks, comm, err := readProcStat(pid)
+		if err != nil {
+			continue
+		}
+		nextTicks[pid] = ticks
+
+		var cpuPct float64
+		if p.ready && total > p.prevTotal {
+			if prevTicks, ok := p.prevTicks[pid]; ok && ticks >= prevTicks {
+				dTicks := float64(ticks - prevTicks)
+				dTotal := float64(total - p.prevTotal)
+				cpuPct = dTicks / dTotal * 100 * float64(runtime.NumCPU())
+			}
+		}
+
+		metrics = append(metrics, procMetric{
+			Pid:        pid,
+			Name:       comm,
+			CPUPercent: cpuPct,
+			RSSBytes:   readProcRSS(pid),
+		})
+	}
+
+	p.prevTicks = nextTicks
+	p.prevTotal = total
+	p.ready = true
+
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].CPUPercent != metrics[j].CPUPercent {
+			return metrics[i].CPUPercent > metrics[j].CPUPercent
+		}
+		return metrics[i].RSSBytes > metrics[j].RSSBytes
+	})
+	if n > 0 && len(metrics) > n {
+		metrics = metrics[:n]
+	}
+
+	for i := range metrics {
+		pid := metrics[i].Pid
+		if cmdline := readProcCmdline(pid); cmdline != "" {
+			metrics[i].Name = cmdline
+		}
+		metrics[i].User = lookupProcUser(pid)
+		metrics[i].FDCount = countProcFDs(pid)
+	}
+	return metrics, nil
+}
+
+func listPIDs() ([]int, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	pids := make([]int, 0, len(entries))
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
+// readProcStat returns the process's utime+stime (in clock ticks) and comm
+// name from /proc/[pid]/stat, handling comm values that contain spaces or
+// parentheses.
+func readProcStat(pid int) (ticks uint64, comm string, err error) {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, "", err
+	}
+	line := string(b)
+	open := strings.IndexByte(line, '(')
+	close := strings.LastIndexByte(line, ')')
+	if open < 0 || close < 0 || close < open {
+		return 0, "", fmt.Errorf("unexpected /proc/%d/stat format", pid)
+	}
+	comm = line[open+1 : close]
+	fields := strings.Fields(line[close+1:])
+	// fields[0] is state (field 3); utime is field 14, stime is field 15,
+	// i.e. fields[11] and fields[12] of this remainder slice.
+	if len(fields) < 13 {
+		return 0, "", fmt.Errorf("unexpected /proc/%d/stat field count", pid)
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return 0, "", err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return 0, "", err
+	}
+	return utime + stime, comm, nil
+}
+
+func readProcCmdline(pid int) string {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil || len(b) == 0 {
+		return ""
+	}
+	b = trimNulSuffix(b)
+	return strings.TrimSpace(strings.ReplaceAll(string(b), "\x00", " "))
+}
+
+// trimNulSuffix strips trailing NUL bytes left by /proc/[pid]/cmdline.
+func trimNulSuffix(b []byte) []byte {
+	i := len(b)
+	for i > 0 && b[i-1] == 0 {
+		i--
+	}
+	return b[:i]
+}
+
+func readProcRSS(pid int) int64 {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "VmRSS:") {
+			kb, _ := parseMeminfoKB(line)
+			return kb * 1024
+		}
+	}
+	return 0
+}
+
+func lookupProcUser(pid int) string {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if !strings.HasPrefix(line, "Uid:") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return ""
+		}
+		if u, err := user.LookupId(fields[1]); err == nil {
+			return u.Username
+		}
+		return fields[1]
+	}
+	return ""
+}
+
+func countProcFDs(pid int) int {
+	entries, err := os.ReadDir(fmt.Sprintf("/proc/%d/fd", pid))
+	if err != nil {
+		return 0
+	}
+	return len(entries)
+}
+
+// readNets parses all 16 counter columns of /proc/net/dev and returns, per
+// interface, the bytes, packets, errs, and drop counters of each direction,
+// skipping loopback like the legacy aggregate readNet does.
+func readNets() ([]netMetric, error) {
+	f, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for i := 0; i < 2; i++ {
+		if !sc.Scan() {
+			return nil, fmt.Errorf("bad /proc/net/dev")
+		}
+	}
+
+	var nets []netMetric
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		parts := strings.Fields(line)
+		if len(parts) < 17 {
+			continue
+		}
+		iface := strings.TrimSuffix(parts[0], ":")
+		if iface == "lo" {
+			continue
+		}
+		cols := make([]int64, 0, 16)
+		for _, p := range parts[1:17] {
+			n, err := strconv.ParseInt(p, 10, 64)
+			if err != nil {
+				cols = append(cols, 0)
+				continue
+			}
+			cols = append(cols, n)
+		}
+		nets = append(nets, netMetric{
+			Name:      iface,
+			RxBytes:   cols[0],
+			RxPackets: cols[1],
+			RxErrs:    cols[2],
+			RxDrop:    cols[3],
+			TxBytes:   cols[8],
+			TxPackets: cols[9],
+			TxErrs:    cols[10],
+			TxDrop:    cols[11],
+		})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return nets, nil
+}
+
+// pseudoFSTypes are filesystems that do not represent real, measurable
+// storage and are excluded from readDisks.
+var pseudoFSTypes = map[string]bool{
+	"tmpfs":       true,
+	"devtmpfs":    true,
+	"overlay":     true,
+	"squashfs":    true,
+	"proc":        true,
+	"sysfs":       true,
+	"cgroup":      true,
+	"cgroup2":     true,
+	"devpts":      true,
+	"mqueue":      true,
+	"debugfs":     true,
+	"tracefs":     true,
+	"securityfs":  true,
+	"pstore":      true,
+	"bpf":         true,
+	"autofs":      true,
+	"binfmt_misc": true,
+	"configfs":    true,
+	"fusectl":     true,
+	"hugetlbfs":   true,
+	"rpc_pipefs":  true,
+}
+
+// readDisks enumerates real mount points from /proc/self/mountinfo and
+// reports usage for each, joined with block-device IO counters from
+// /proc/diskstats when available.
+func readDisks() ([]diskMetric, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ioStats := readDiskStats()
+
+	seen := make(map[string]bool)
+	var disks []diskMetric
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		mount, fsType, source, ok := parseMountinfoLine(sc.Text())
+		if !ok || pseudoFSTypes[fsType] || seen[mount] {
+			continue
+		}
+		seen[mount] = true
+
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(mount, &st); err != nil {
+			continue
+		}
+		total := int64(st.Blocks) * int64(st.Bsize)
+		free := int64(st.Bavail) * int64(st.Bsize)
+		used := total - free
+		if used < 0 {
+			used = 0
+		}
+		inodeTotal := int64(st.Files)
+		inodeFree := int64(st.Ffree)
+		inodeUsed := inodeTotal - inodeFree
+		if inodeUsed < 0 {
+			inodeUsed = 0
+		}
+
+		d := diskMetric{
+			Mount:      mount,
+			Device:     source,
+			Used:       used,
+			Total:      total,
+			InodeUsed:  inodeUsed,
+			InodeTotal: inodeTotal,
+		}
+		if io, ok := ioStats[filepath.Base(source)]; ok {
+			d.Reads = io.reads
+			d.Writes = io.writes
+			d.ReadBytes = io.readBytes
+			d.WriteBytes = io.writeBytes
+			d.IOTimeMs = io.ioTimeMs
+		}
+		disks = append(disks, d)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return disks, nil
+}
+
+// parseMountinfoLine parses a single /proc/self/mountinfo line into its
+// mount point, filesystem type, and source device.
+func parseMountinfoLine(line string) (mount, fsType, source string, ok bool) {
+	// Format: mountId parentId major:minor root mountPoint options
+	// [optionalFields...] - fsType source superOptions
+	fields := strings.Fields(line)
+	sepIdx := -1
+	for i, f := range fields {
+		if f == "-" {
+			sepIdx = i
+			break
+		}
+	}
+	if sepIdx < 0 || len(fields) < sepIdx+3 || len(fields) < 5 {
+		return "", "", "", false
+	}
+	mount = fields[4]
+	fsType = fields[sepIdx+1]
+	source = fields[sepIdx+2]
+	return mount, fsType, source, true
+}
+
+type diskIOStats struct {
+	reads      int64
+	writes     int64
+	readBytes  int64
+	writeBytes int64
+	ioTimeMs   int64
+}
+
+// sectorSize is the historical Linux block-layer sector size used to scale
+// /proc/diskstats' sector counts into bytes; this is fixed regardless of the
+// device's actual physical sector size.
+const sectorSize = 512
+
+// readDiskStats parses /proc/diskstats into a map keyed by device name
+// (e.g. "sda1").
+func readDiskStats() map[string]diskIOStats {
+	out := make(map[string]diskIOStats)
+	f, err := os.Open("/proc/diskstats")
+	if err != nil {
+		return out
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 13 {
+			continue
+		}
+		name := fields[2]
+		reads, _ := strconv.ParseInt(fields[3], 10, 64)
+		sectorsRead, _ := strconv.ParseInt(fields[5], 10, 64)
+		writes, _ := strconv.ParseInt(fields[7], 10, 64)
+		sectorsWritten, _ := strconv.ParseInt(fields[9], 10, 64)
+		ioTimeMs, _ := strconv.ParseInt(fields[12], 10, 64)
+		out[name] = diskIOStats{
+			reads:      reads,
+			writes:     writes,
+			readBytes:  sectorsRead * sectorSize,
+			writeBytes: sectorsWritten * sectorSize,
+			ioTimeMs:   ioTimeMs,
+		}
+	}
+	return out
+}
+
+// readUptime returns seconds since boot, from /proc/uptime.
+func readUptime() (float64, error) {
+	b, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0, err
+	}
+	parts := strings.Fields(string(b))
+	if len(parts) < 1 {
+		return 0, fmt.Errorf("bad /proc/uptime")
+	}
+	return strconv.ParseFloat(parts[0], 64)
+}
+
+// readBootTime returns the Unix timestamp the kernel booted at, from
+// /proc/stat's "btime" line. This stays fixed until the next reboot in a way that
+// "now - uptime" is not, since uptime drifts with clock adjustments.
+func readBootTime() (int64, error) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if !strings.HasPrefix(line, "btime") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return 0, fmt.Errorf("bad btime line")
+		}
+		return strconv.ParseInt(fields[1], 10, 64)
+	}
+	return 0, fmt.Errorf("btime not found in /proc/stat")
+}
+
+// readSwap reports used and total swap in bytes, from /proc/meminfo.
+func readSwap() (used int64, total int64, err error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	var totalKB, freeKB int64
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "SwapTotal:") {
+			totalKB, _ = parseMeminfoKB(line)
+		} else if strings.HasPrefix(line, "SwapFree:") {
+			freeKB, _ = parseMeminfoKB(line)
+		}
+	}
+	total = totalKB * 1024
+	used = (totalKB - freeKB) * 1024
+	if used < 0 {
+		used = 0
+	}
+	return used, total, nil
+}
+
+// utmpRecordSize, utmpTypeUserProcess, and the field offsets below match the
+// glibc struct utmp layout on Linux/amd64.
+const (
+	utmpRecordSize      = 384
+	utmpTypeUserProcess = 7
+	utmpOffType         = 0
+	utmpOffUser         = 44
+	utmpUserSize        = 32
+)
+
+// countUsers counts interactive login sessions by reading the fixed-size
+// struct utmp records in /var/run/utmp and filtering USER_PROCESS entries.
+func countUsers() (int, error) {
+	b, err := os.ReadFile("/var/run/utmp")
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for off := 0; off+utmpRecordSize <= len(b); off += utmpRecordSize {
+		rec := b[off : off+utmpRecordSize]
+		typ := int16(rec[utmpOffType]) | int16(rec[utmpOffType+1])<<8
+		if typ != utmpTypeUserProcess {
+			continue
+		}
+		user := rec[utmpOffUser : utmpOffUser+utmpUserSize]
+		if len(trimNulSuffix(user)) == 0 {
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
@@ -2,32 +2,61 @@
 
 package main
 
-import "fmt"
+import "github.com/yamatu/yaws/agent/collector"
 
-type cpuSampler struct{}
+type cpuSampler struct {
+	s *collector.Sampler
+}
 
-func newCPUSampler() *cpuSampler { return &cpuSampler{} }
+func newCPUSampler() *cpuSampler {
+	return &cpuSampler{s: collector.NewSampler()}
+}
 
 func (c *cpuSampler) Usage() (float64, error) {
-	return 0, fmt.Errorf("unsupported OS")
+	return c.s.Usage()
 }
 
 func readMem() (used int64, total int64, err error) {
-	return 0, 0, fmt.Errorf("unsupported OS")
+	return collector.ReadMem()
 }
 
-func readDisk(_ string) (used int64, total int64, err error) {
-	return 0, 0, fmt.Errorf("unsupported OS")
+func readDisk(p string) (used int64, total int64, err error) {
+	return collector.ReadDisk(p)
 }
 
 func readNet() (rxBytes, txBytes int64, err error) {
-	return 0, 0, fmt.Errorf("unsupported OS")
+	return collector.ReadNet()
 }
 
 func readLoad() (l1, l5, l15 float64, err error) {
-	return 0, 0, 0, fmt.Errorf("unsupported OS")
+	return collector.ReadLoad()
 }
 
 func readConnCounts() (tcp int64, udp int64, err error) {
-	return 0, 0, fmt.Errorf("unsupported OS")
+	return collector.ReadConnCounts()
+}
+
+func defaultMetricsSource() metricsSource {
+	return metricsSource{
+		cpu:            newCPUSampler(),
+		readMem:        readMem,
+		readDisk:       readDisk,
+		readNet:        readNet,
+		readLoad:       readLoad,
+		readConnCounts: readConnCounts,
+		topProcs:       newGopsutilTopProcs(),
+		readNets:       gopsutilReadNets,
+		readDisks:      gopsutilReadDisks,
+		readUptime:     collector.ReadUptime,
+		readBootTime:   collector.ReadBootTime,
+		readSwap:       collector.ReadSwap,
+		readUsers:      collector.CountUsers,
+		readContainers: newContainerSampler().Read,
+	}
+}
+
+// selectMetricsSource ignores backend on non-Linux builds: gopsutil is
+// already the only implementation available.
+func selectMetricsSource(backend string) metricsSource {
+	return defaultMetricsSource()
 }
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sharedSource serializes access to a metricsSource so the websocket
+// pipeline's ticker and the Prometheus scrape handler can both call
+// collectMetrics without corrupting stateful samplers like cpuSampler.
+//
+// The top-N process and per-container samplers track CPU usage as a delta
+// since their *previous* call, so the websocket ticker (paced by
+// --interval) and the scrape handler (paced by whatever scrape_interval the
+// external Prometheus uses) can't share one procSampler/containerSampler
+// without one pipeline stealing the other's delta window. promTopProcs and
+// promReadContainers are separate instances dedicated to scrapes; src.cpu
+// is still shared since the aggregate CPU gauge only needs "since the last
+// call to this mutex-guarded sampler," which either pipeline satisfies.
+type sharedSource struct {
+	mu                 sync.Mutex
+	src                metricsSource
+	promTopProcs       func(n int) ([]procMetric, error)
+	promReadContainers func(mode string) ([]containerMetric, error)
+}
+
+func (s *sharedSource) collect(diskPath string, topProcs int, containers string) (metricsMsg, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return collectMetrics(diskPath, s.src, topProcs, containers)
+}
+
+func (s *sharedSource) collectProm(diskPath string, topProcs int, containers string) (metricsMsg, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	src := s.src
+	src.topProcs = s.promTopProcs
+	src.readContainers = s.promReadContainers
+	return collectMetrics(diskPath, src, topProcs, containers)
+}
+
+// warmupCPU primes the CPU sampler's baseline so its first real sample isn't
+// always 0.
+func (s *sharedSource) warmupCPU() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, _ = s.src.cpu.Usage()
+}
+
+// promExporter serves the same numbers collectMetrics produces in
+// OpenMetrics text format, so scraping the agent never disagrees with what
+// it reports over the websocket.
+type promExporter struct {
+	shared     *sharedSource
+	diskPath   string
+	topProcs   int
+	containers string
+}
+
+func startPromServer(addr string, shared *sharedSource, diskPath string, topProcs int, containers string) *http.Server {
+	exp := &promExporter{shared: shared, diskPath: diskPath, topProcs: topProcs, containers: containers}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exp)
+	srv := &http.Server{Addr: addr, Handler: mux}
+	return srv
+}
+
+func (e *promExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m, err := e.shared.collectProm(e.diskPath, e.topProcs, e.containers)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	var b strings.Builder
+
+	writeGauge(&b, "yaws_cpu_usage_ratio", "Fraction of CPU time spent non-idle since the last sample.", nil, m.CPU.Usage)
+	writeGauge(&b, "yaws_mem_used_bytes", "Used physical memory in bytes.", nil, float64(m.Mem.Used))
+	writeGauge(&b, "yaws_mem_total_bytes", "Total physical memory in bytes.", nil, float64(m.Mem.Total))
+
+	writeGauge(&b, "yaws_load", "Load average.", map[string]string{"window": "1"}, m.Load.L1)
+	writeGauge(&b, "yaws_load", "", map[string]string{"window": "5"}, m.Load.L5)
+	writeGauge(&b, "yaws_load", "", map[string]string{"window": "15"}, m.Load.L15)
+
+	if m.Conn != nil {
+		writeGauge(&b, "yaws_conn_count", "Open connection count.", map[string]string{"proto": "tcp"}, float64(m.Conn.TCP))
+		writeGauge(&b, "yaws_conn_count", "", map[string]string{"proto": "udp"}, float64(m.Conn.UDP))
+	}
+
+	if len(m.Disks) == 0 {
+		labels := map[string]string{"mount": e.diskPath}
+		writeGauge(&b, "yaws_disk_used_bytes", "Used bytes per mount point.", labels, float64(m.Disk.Used))
+		writeGauge(&b, "yaws_disk_total_bytes", "Total bytes per mount point.", labels, float64(m.Disk.Total))
+	}
+	for i, d := range m.Disks {
+		labels := map[string]string{"mount": d.Mount}
+		writeGauge(&b, "yaws_disk_used_bytes", helpOnFirst(i, "Used bytes per mount point."), labels, float64(d.Used))
+		writeGauge(&b, "yaws_disk_total_bytes", helpOnFirst(i, "Total bytes per mount point."), labels, float64(d.Total))
+	}
+
+	if len(m.Nets) == 0 {
+		writeCounter(&b, "yaws_net_rx_bytes_total", "Received bytes per interface.", nil, float64(m.Net.RxBytes))
+		writeCounter(&b, "yaws_net_tx_bytes_total", "Transmitted bytes per interface.", nil, float64(m.Net.TxBytes))
+	}
+	for i, n := range m.Nets {
+		labels := map[string]string{"iface": n.Name}
+		writeCounter(&b, "yaws_net_rx_bytes_total", helpOnFirst(i, "Received bytes per interface."), labels, float64(n.RxBytes))
+		writeCounter(&b, "yaws_net_tx_bytes_total", helpOnFirst(i, "Transmitted bytes per interface."), labels, float64(n.TxBytes))
+	}
+
+	for i, p := range m.Procs {
+		labels := map[string]string{"pid": strconv.Itoa(p.Pid), "name": p.Name}
+		writeGauge(&b, "yaws_proc_cpu_percent", helpOnFirst(i, "Per-process CPU percent, top-N only."), labels, p.CPUPercent)
+		writeGauge(&b, "yaws_proc_rss_bytes", helpOnFirst(i, "Per-process RSS bytes, top-N only."), labels, float64(p.RSSBytes))
+	}
+
+	for i, c := range m.Containers {
+		labels := map[string]string{"id": c.ID, "name": c.Name}
+		writeGauge(&b, "yaws_container_cpu_percent", helpOnFirst(i, "Per-container CPU percent."), labels, c.CPUPercent)
+		writeGauge(&b, "yaws_container_mem_used_bytes", helpOnFirst(i, "Per-container memory usage in bytes."), labels, float64(c.MemUsed))
+	}
+
+	b.WriteString("# EOF\n")
+	_, _ = w.Write([]byte(b.String()))
+}
+
+// helpOnFirst returns help for the first series in a metric family and ""
+// for the rest, so writeMetric only emits HELP/TYPE once per family.
+func helpOnFirst(i int, help string) string {
+	if i == 0 {
+		return help
+	}
+	return ""
+}
+
+func writeGauge(b *strings.Builder, name, help string, labels map[string]string, v float64) {
+	writeMetric(b, name, "gauge", help, labels, v)
+}
+
+func writeCounter(b *strings.Builder, name, help string, labels map[string]string, v float64) {
+	writeMetric(b, name, "counter", help, labels, v)
+}
+
+func writeMetric(b *strings.Builder, name, metricType, help string, labels map[string]string, v float64) {
+	if help != "" {
+		fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(b, "# TYPE %s %s\n", name, metricType)
+	}
+	fmt.Fprintf(b, "%s%s %s\n", name, formatLabels(labels), strconv.FormatFloat(v, 'g', -1, 64))
+}
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	// Deterministic order keeps scrapes diffable; both call sites only ever
+	// use one or two well-known keys.
+	keys := []string{"mount", "iface", "proto", "window", "pid", "id", "name"}
+	var pairs []string
+	for _, k := range keys {
+		if v, ok := labels[k]; ok {
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, k, escapeLabelValue(v)))
+		}
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// escapeLabelValue escapes a label value per the OpenMetrics/Prometheus text
+// grammar, which only defines \\, \", and \n — unlike %q, it must not
+// produce \xNN/\uNNNN escapes for other bytes (e.g. from a process's raw
+// /proc/<pid>/cmdline), which a compliant scraper would fail to parse.
+func escapeLabelValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	return v
+}
+
+func shutdownPromServer(srv *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = srv.Shutdown(ctx)
+}
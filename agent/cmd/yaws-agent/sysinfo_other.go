@@ -2,7 +2,11 @@
 
 package main
 
-import "runtime"
+import (
+	"runtime"
+
+	"github.com/yamatu/yaws/agent/collector"
+)
 
 type sysInfo struct {
 	OSName        string
@@ -14,11 +18,20 @@ type sysInfo struct {
 }
 
 func getSysInfo() sysInfo {
+	info, err := collector.GetSysInfo()
+	if err != nil && info.OSName == "" {
+		return sysInfo{
+			OSName:   runtime.GOOS,
+			Arch:     runtime.GOARCH,
+			CPUCores: runtime.NumCPU(),
+		}
+	}
 	return sysInfo{
-		OSName:    runtime.GOOS,
-		Arch:      runtime.GOARCH,
-		CPUCores:  runtime.NumCPU(),
-		CPUModel:  "",
-		OSVersion: "",
+		OSName:        info.OSName,
+		OSVersion:     info.OSVersion,
+		Arch:          info.Arch,
+		KernelVersion: info.KernelVersion,
+		CPUModel:      info.CPUModel,
+		CPUCores:      info.CPUCores,
 	}
 }
@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	gopsnet "github.com/shirou/gopsutil/v3/net"
+)
+
+// NetMetric mirrors the agent's netMetric struct.
+type NetMetric struct {
+	Name      string
+	RxBytes   int64
+	TxBytes   int64
+	RxPackets int64
+	TxPackets int64
+	RxErrs    int64
+	TxErrs    int64
+	RxDrop    int64
+	TxDrop    int64
+}
+
+// ReadNets returns a per-interface breakdown, skipping loopback.
+func ReadNets() ([]NetMetric, error) {
+	counters, err := gopsnet.IOCounters(true)
+	if err != nil {
+		return nil, err
+	}
+	nets := make([]NetMetric, 0, len(counters))
+	for _, c := range counters {
+		if strings.HasPrefix(c.Name, "lo") {
+			continue
+		}
+		nets = append(nets, NetMetric{
+			Name:      c.Name,
+			RxBytes:   int64(c.BytesRecv),
+			TxBytes:   int64(c.BytesSent),
+			RxPackets: int64(c.PacketsRecv),
+			TxPackets: int64(c.PacketsSent),
+			RxErrs:    int64(c.Errin),
+			TxErrs:    int64(c.Errout),
+			RxDrop:    int64(c.Dropin),
+			TxDrop:    int64(c.Dropout),
+		})
+	}
+	return nets, nil
+}
+
+// DiskMetric mirrors the agent's diskMetric struct.
+type DiskMetric struct {
+	Mount      string
+	Device     string
+	Used       int64
+	Total      int64
+	InodeUsed  int64
+	InodeTotal int64
+	Reads      int64
+	Writes     int64
+	ReadBytes  int64
+	WriteBytes int64
+	IOTimeMs   int64
+}
+
+// ReadDisks enumerates real partitions and reports usage plus IO counters
+// for each.
+func ReadDisks() ([]DiskMetric, error) {
+	partitions, err := disk.Partitions(false)
+	if err != nil {
+		return nil, err
+	}
+	io, _ := disk.IOCounters()
+
+	disks := make([]DiskMetric, 0, len(partitions))
+	for _, p := range partitions {
+		u, err := disk.Usage(p.Mountpoint)
+		if err != nil {
+			continue
+		}
+		d := DiskMetric{
+			Mount:      p.Mountpoint,
+			Device:     p.Device,
+			Used:       int64(u.Used),
+			Total:      int64(u.Total),
+			InodeUsed:  int64(u.InodesUsed),
+			InodeTotal: int64(u.InodesTotal),
+		}
+		if stat, ok := io[deviceName(p.Device)]; ok {
+			d.Reads = int64(stat.ReadCount)
+			d.Writes = int64(stat.WriteCount)
+			d.ReadBytes = int64(stat.ReadBytes)
+			d.WriteBytes = int64(stat.WriteBytes)
+			d.IOTimeMs = int64(stat.IoTime)
+		}
+		disks = append(disks, d)
+	}
+	return disks, nil
+}
+
+func deviceName(devicePath string) string {
+	idx := strings.LastIndexByte(devicePath, '/')
+	if idx < 0 {
+		return devicePath
+	}
+	return devicePath[idx+1:]
+}
@@ -0,0 +1,188 @@
+// Package collector provides a gopsutil-backed implementation of the metrics
+// gathered natively from /proc on Linux. It is used as the only backend on
+// platforms without a /proc filesystem (darwin, windows, freebsd) and can be
+// opted into on Linux via the agent's --backend=gopsutil flag for parity
+// testing against the native implementation.
+package collector
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+	gopsnet "github.com/shirou/gopsutil/v3/net"
+)
+
+// Sampler tracks CPU time deltas across calls to Usage, mirroring the
+// semantics of the native /proc-based cpuSampler.
+type Sampler struct {
+	prevIdle  float64
+	prevTotal float64
+	ready     bool
+}
+
+// NewSampler returns a Sampler with no baseline yet: its first call to Usage
+// records one and returns 0.
+func NewSampler() *Sampler {
+	return &Sampler{}
+}
+
+// Usage returns the fraction of CPU time spent non-idle since the previous
+// call, or 0 on the first call while the baseline is established.
+func (s *Sampler) Usage() (float64, error) {
+	times, err := cpu.Times(false)
+	if err != nil {
+		return 0, err
+	}
+	if len(times) == 0 {
+		return 0, fmt.Errorf("collector: no cpu times returned")
+	}
+	t := times[0]
+	idle := t.Idle + t.Iowait
+	total := t.User + t.System + t.Idle + t.Nice + t.Iowait + t.Irq + t.Softirq + t.Steal
+
+	if !s.ready {
+		s.prevIdle = idle
+		s.prevTotal = total
+		s.ready = true
+		return 0, nil
+	}
+	dIdle := idle - s.prevIdle
+	dTotal := total - s.prevTotal
+	s.prevIdle = idle
+	s.prevTotal = total
+	if dTotal <= 0 {
+		return 0, nil
+	}
+	return 1 - (dIdle / dTotal), nil
+}
+
+// ReadMem reports used and total physical memory in bytes.
+func ReadMem() (used int64, total int64, err error) {
+	vm, err := mem.VirtualMemory()
+	if err != nil {
+		return 0, 0, err
+	}
+	return int64(vm.Used), int64(vm.Total), nil
+}
+
+// ReadDisk reports used and total bytes on the filesystem containing path.
+func ReadDisk(path string) (used int64, total int64, err error) {
+	u, err := disk.Usage(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int64(u.Used), int64(u.Total), nil
+}
+
+// ReadNet sums received and transmitted bytes across all non-loopback
+// interfaces.
+func ReadNet() (rxBytes int64, txBytes int64, err error) {
+	counters, err := gopsnet.IOCounters(true)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, c := range counters {
+		if strings.HasPrefix(c.Name, "lo") {
+			continue
+		}
+		rxBytes += int64(c.BytesRecv)
+		txBytes += int64(c.BytesSent)
+	}
+	return rxBytes, txBytes, nil
+}
+
+// ReadLoad reports the 1/5/15 minute load averages.
+func ReadLoad() (l1, l5, l15 float64, err error) {
+	avg, err := load.Avg()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return avg.Load1, avg.Load5, avg.Load15, nil
+}
+
+// ReadConnCounts reports the number of open TCP and UDP connections.
+func ReadConnCounts() (tcpCount int64, udpCount int64, err error) {
+	tcpConns, err := gopsnet.Connections("tcp")
+	if err != nil {
+		return 0, 0, err
+	}
+	udpConns, err := gopsnet.Connections("udp")
+	if err != nil {
+		return 0, 0, err
+	}
+	return int64(len(tcpConns)), int64(len(udpConns)), nil
+}
+
+// ReadUptime returns seconds since boot.
+func ReadUptime() (float64, error) {
+	uptime, err := host.Uptime()
+	if err != nil {
+		return 0, err
+	}
+	return float64(uptime), nil
+}
+
+// ReadBootTime returns the Unix timestamp the host booted at.
+func ReadBootTime() (int64, error) {
+	boot, err := host.BootTime()
+	if err != nil {
+		return 0, err
+	}
+	return int64(boot), nil
+}
+
+// ReadSwap reports used and total swap in bytes.
+func ReadSwap() (used int64, total int64, err error) {
+	s, err := mem.SwapMemory()
+	if err != nil {
+		return 0, 0, err
+	}
+	return int64(s.Used), int64(s.Total), nil
+}
+
+// CountUsers counts interactive login sessions.
+func CountUsers() (int, error) {
+	users, err := host.Users()
+	if err != nil {
+		return 0, err
+	}
+	return len(users), nil
+}
+
+// SysInfo mirrors the agent's sysInfo struct so callers can copy it across
+// the package boundary without a gopsutil dependency of their own.
+type SysInfo struct {
+	OSName        string
+	OSVersion     string
+	Arch          string
+	KernelVersion string
+	CPUModel      string
+	CPUCores      int
+}
+
+// GetSysInfo reports host and CPU identification via gopsutil.
+func GetSysInfo() (SysInfo, error) {
+	info := SysInfo{
+		Arch:     runtime.GOARCH,
+		CPUCores: runtime.NumCPU(),
+	}
+	hostInfo, err := host.Info()
+	if err == nil {
+		info.OSName = hostInfo.Platform
+		info.OSVersion = hostInfo.PlatformVersion
+		info.KernelVersion = hostInfo.KernelVersion
+	}
+	if cpuInfo, err := cpu.Info(); err == nil && len(cpuInfo) > 0 {
+		info.CPUModel = cpuInfo[0].ModelName
+	}
+	if info.OSName == "" {
+		info.OSName = runtime.GOOS
+	}
+	return info, err
+}
@@ -0,0 +1,103 @@
+package collector
+
+import (
+	"sort"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// ProcMetric mirrors the agent's procMetric struct so callers can copy it
+// across the package boundary without a gopsutil dependency of their own.
+type ProcMetric struct {
+	Pid        int32
+	Name       string
+	User       string
+	CPUPercent float64
+	RSSBytes   int64
+	FDCount    int32
+}
+
+// ProcSampler tracks per-pid CPU time deltas across calls to Top, mirroring
+// the semantics of the native /proc-based procSampler: gopsutil's own
+// Process.CPUPercent() can't be used here because process.Processes()
+// returns brand-new *Process values every call, so it has no baseline from
+// the agent's previous sample to diff against.
+type ProcSampler struct {
+	prevTimes map[int32]float64
+	prevAt    time.Time
+	ready     bool
+}
+
+// NewProcSampler returns a ProcSampler with no baseline yet: its first call
+// to Top records one and reports 0 CPU percent for every process.
+func NewProcSampler() *ProcSampler {
+	return &ProcSampler{prevTimes: make(map[int32]float64)}
+}
+
+// Top returns the top n processes by CPU percent (ties broken by RSS),
+// sampled as CPU seconds consumed since the previous call to Top.
+func (s *ProcSampler) Top(n int) ([]ProcMetric, error) {
+	procs, err := process.Processes()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(s.prevAt).Seconds()
+
+	metrics := make([]ProcMetric, 0, len(procs))
+	nextTimes := make(map[int32]float64, len(procs))
+	for _, p := range procs {
+		times, err := p.Times()
+		if err != nil {
+			continue
+		}
+		cpuSecs := times.User + times.System
+		nextTimes[p.Pid] = cpuSecs
+
+		var cpuPct float64
+		if s.ready && elapsed > 0 {
+			if prev, ok := s.prevTimes[p.Pid]; ok && cpuSecs >= prev {
+				cpuPct = (cpuSecs - prev) / elapsed * 100
+			}
+		}
+
+		name, err := p.Name()
+		if err != nil || name == "" {
+			if cmdline, err := p.Cmdline(); err == nil {
+				name = cmdline
+			}
+		}
+		user, _ := p.Username()
+		var rss int64
+		if mi, err := p.MemoryInfo(); err == nil && mi != nil {
+			rss = int64(mi.RSS)
+		}
+		fds, _ := p.NumFDs()
+
+		metrics = append(metrics, ProcMetric{
+			Pid:        p.Pid,
+			Name:       name,
+			User:       user,
+			CPUPercent: cpuPct,
+			RSSBytes:   rss,
+			FDCount:    fds,
+		})
+	}
+
+	s.prevTimes = nextTimes
+	s.prevAt = now
+	s.ready = true
+
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].CPUPercent != metrics[j].CPUPercent {
+			return metrics[i].CPUPercent > metrics[j].CPUPercent
+		}
+		return metrics[i].RSSBytes > metrics[j].RSSBytes
+	})
+	if n >= 0 && len(metrics) > n {
+		metrics = metrics[:n]
+	}
+	return metrics, nil
+}
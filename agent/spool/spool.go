@@ -0,0 +1,246 @@
+// Package spool implements a bounded, on-disk store-and-forward buffer for
+// the agent's metrics samples. Samples are appended as length-prefixed
+// frames to append-only segment files, so a write never requires rewriting
+// existing data; segments rotate once they hit the rotation threshold
+// (segmentBytes, or less for a small cap; see segmentSizeFor), and the oldest
+// segments are dropped once the spool's total size exceeds its configured
+// cap. Appends are never fsynced (only Frames syncs the live segment before
+// reading it back): a lost write on a hard crash is acceptable, the spool
+// only needs to survive ordinary reconnect/backoff gaps.
+package spool
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// segmentBytes is the default size of a single segment file before it is
+// rotated, used when maxBytes is large enough (or unbounded) not to
+// constrain it. evictOldest never deletes the currently-open segment, so
+// this is also the live segment's maximum slack over the configured cap;
+// segmentSizeFor shrinks it for small --spool-max-bytes values so that
+// slack can't dwarf the cap itself.
+const segmentBytes = 1 << 20 // 1MiB
+
+// minSegmentBytes floors the rotation threshold so a very small
+// --spool-max-bytes still rotates at a workable granularity instead of
+// rotating on nearly every append.
+const minSegmentBytes = 4 << 10 // 4KiB
+
+const segmentSuffix = ".seg"
+
+// Spool is a bounded, ordered, on-disk queue of opaque frames.
+type Spool struct {
+	dir      string
+	maxBytes int64
+	segBytes int64
+
+	mu       sync.Mutex
+	segments []segmentInfo
+	cur      *os.File
+	curSize  int64
+}
+
+// segmentSizeFor derives the per-segment rotation threshold from the
+// spool's configured byte cap, so a small --spool-max-bytes can't leave the
+// live segment growing to just under the 1MiB default before it ever
+// rotates and evictOldest gets a chance to enforce the cap.
+func segmentSizeFor(maxBytes int64) int64 {
+	if maxBytes <= 0 {
+		return segmentBytes
+	}
+	quarter := maxBytes / 4
+	if quarter >= segmentBytes {
+		return segmentBytes
+	}
+	if quarter < minSegmentBytes {
+		return minSegmentBytes
+	}
+	return quarter
+}
+
+type segmentInfo struct {
+	seq  int64
+	size int64
+}
+
+// New opens (or creates) a spool rooted at dir, bounded to maxBytes total
+// across all segments.
+func New(dir string, maxBytes int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	s := &Spool{dir: dir, maxBytes: maxBytes, segBytes: segmentSizeFor(maxBytes)}
+	if err := s.loadSegments(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Spool) loadSegments() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), segmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseInt(strings.TrimSuffix(e.Name(), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		s.segments = append(s.segments, segmentInfo{seq: seq, size: info.Size()})
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].seq < s.segments[j].seq })
+	return nil
+}
+
+func (s *Spool) segmentPath(seq int64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, segmentSuffix))
+}
+
+func (s *Spool) totalBytes() int64 {
+	var total int64
+	for _, seg := range s.segments {
+		total += seg.size
+	}
+	return total
+}
+
+// Append writes data as a new length-prefixed frame, rotating segments and
+// evicting the oldest data as needed to respect the configured byte cap.
+func (s *Spool) Append(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+
+	if s.cur == nil || s.curSize+int64(len(frame)) > s.segBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.cur.Write(frame)
+	if err != nil {
+		return err
+	}
+	s.curSize += int64(n)
+	s.segments[len(s.segments)-1].size = s.curSize
+
+	return s.evictOldest()
+}
+
+func (s *Spool) rotate() error {
+	if s.cur != nil {
+		if err := s.cur.Close(); err != nil {
+			return err
+		}
+	}
+	var nextSeq int64
+	if len(s.segments) > 0 {
+		nextSeq = s.segments[len(s.segments)-1].seq + 1
+	}
+	f, err := os.OpenFile(s.segmentPath(nextSeq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	s.cur = f
+	s.curSize = 0
+	s.segments = append(s.segments, segmentInfo{seq: nextSeq})
+	return nil
+}
+
+// evictOldest deletes the oldest segments until the spool is back under its
+// byte cap. It never deletes the currently-open segment.
+func (s *Spool) evictOldest() error {
+	if s.maxBytes <= 0 {
+		return nil
+	}
+	for s.totalBytes() > s.maxBytes && len(s.segments) > 1 {
+		oldest := s.segments[0]
+		if err := os.Remove(s.segmentPath(oldest.seq)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		s.segments = s.segments[1:]
+	}
+	return nil
+}
+
+// Frames returns every spooled frame in the order it was appended.
+func (s *Spool) Frames() ([][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cur != nil {
+		if err := s.cur.Sync(); err != nil {
+			return nil, err
+		}
+	}
+
+	var frames [][]byte
+	for _, seg := range s.segments {
+		segFrames, err := readFrames(s.segmentPath(seg.seq))
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, segFrames...)
+	}
+	return frames, nil
+}
+
+func readFrames(path string) ([][]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var frames [][]byte
+	for len(b) > 0 {
+		if len(b) < 4 {
+			break // truncated trailing write; ignore
+		}
+		n := binary.BigEndian.Uint32(b)
+		b = b[4:]
+		if uint64(len(b)) < uint64(n) {
+			break // truncated trailing write; ignore
+		}
+		frames = append(frames, b[:n])
+		b = b[n:]
+	}
+	return frames, nil
+}
+
+// Clear discards every spooled frame, typically called once a drained batch
+// has been written to the controller.
+func (s *Spool) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cur != nil {
+		if err := s.cur.Close(); err != nil {
+			return err
+		}
+		s.cur = nil
+		s.curSize = 0
+	}
+	for _, seg := range s.segments {
+		if err := os.Remove(s.segmentPath(seg.seq)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	s.segments = nil
+	return nil
+}